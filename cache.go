@@ -0,0 +1,168 @@
+package goupdate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+// CacheEntry records the outcome of a previous `try` attempt for a given
+// set of module versions.
+type CacheEntry struct {
+	Pass bool      `json:"pass"`
+	Time time.Time `json:"time"`
+}
+
+// Cache memoizes the outcome of testing a set of module upgrades, keyed by
+// a hash of the sorted (path@version) tuples, the test command, and a
+// fingerprint of go.sum. It also remembers individual module versions that
+// are known to fail on their own, so they can be excluded from future
+// candidate sets without re-testing them.
+type Cache struct {
+	path string
+	mu   sync.Mutex
+
+	Entries       map[string]CacheEntry `json:"entries"`
+	BadSingletons map[string]time.Time  `json:"badSingletons"`
+}
+
+// LoadCache reads the cache at path, returning an empty Cache if the file
+// does not exist yet.
+func LoadCache(path string) (*Cache, error) {
+	c := &Cache{
+		path:          path,
+		Entries:       map[string]CacheEntry{},
+		BadSingletons: map[string]time.Time{},
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, c); err != nil {
+		return nil, fmt.Errorf("parsing cache %s: %w", path, err)
+	}
+	if c.Entries == nil {
+		c.Entries = map[string]CacheEntry{}
+	}
+	if c.BadSingletons == nil {
+		c.BadSingletons = map[string]time.Time{}
+	}
+	return c, nil
+}
+
+// Save writes the cache back to disk, creating its parent directory if
+// necessary.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, buf, 0644)
+}
+
+// Lookup returns the cached pass/fail result for key, if present and not
+// older than ttl (ttl <= 0 means entries never expire).
+func (c *Cache) Lookup(key string, ttl time.Duration) (pass, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, found := c.Entries[key]
+	if !found {
+		return false, false
+	}
+	if ttl > 0 && time.Since(entry.Time) > ttl {
+		return false, false
+	}
+	return entry.Pass, true
+}
+
+// Store records the result of testing key.
+func (c *Cache) Store(key string, pass bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries[key] = CacheEntry{Pass: pass, Time: time.Now()}
+}
+
+// MarkBad records that path@version fails on its own.
+func (c *Cache) MarkBad(path, version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.BadSingletons[path+"@"+version] = time.Now()
+}
+
+// IsBad reports whether path@version is a known-bad singleton.
+func (c *Cache) IsBad(path, version string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.BadSingletons[path+"@"+version]
+	return ok
+}
+
+// CacheKey hashes testCommand, fingerprint (typically a go.sum digest), and
+// the sorted (path@version) tuples of updates into a single cache key.
+func CacheKey(testCommand, fingerprint string, updates []*modfile.Require) string {
+	tuples := make([]string, len(updates))
+	for i, u := range updates {
+		tuples[i] = u.Mod.Path + "@" + u.Mod.Version
+	}
+	sort.Strings(tuples)
+
+	h := sha256.New()
+	io.WriteString(h, testCommand)
+	for _, t := range tuples {
+		io.WriteString(h, "\x00")
+		io.WriteString(h, t)
+	}
+	io.WriteString(h, "\x00")
+	io.WriteString(h, fingerprint)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GoSumFingerprint returns a digest of rootDir's go.sum, or the empty
+// string if it doesn't have one.
+func GoSumFingerprint(rootDir string) string {
+	buf, err := ioutil.ReadFile(filepath.Join(rootDir, "go.sum"))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// DefaultCachePath returns the default cache location for rootDir, under
+// $XDG_CACHE_HOME (or the platform equivalent via os.UserCacheDir),
+// namespaced by a hash of rootDir's absolute path so multiple modules don't
+// collide.
+func DefaultCachePath(rootDir string) string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+
+	abs, err := filepath.Abs(rootDir)
+	if err != nil {
+		abs = rootDir
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(base, "goupdate", hex.EncodeToString(sum[:8])+".json")
+}
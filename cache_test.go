@@ -0,0 +1,138 @@
+package goupdate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestCacheLookupStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goupdate-cache-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := LoadCache(filepath.Join(dir, "cache.json"))
+	if err != nil {
+		t.Fatalf("LoadCache: %s", err)
+	}
+
+	if _, ok := c.Lookup("missing", 0); ok {
+		t.Fatalf("Lookup of unknown key returned ok=true")
+	}
+
+	c.Store("key", true)
+	pass, ok := c.Lookup("key", 0)
+	if !ok || !pass {
+		t.Fatalf("Lookup after Store: got (%v, %v), want (true, true)", pass, ok)
+	}
+
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+
+	reloaded, err := LoadCache(c.path)
+	if err != nil {
+		t.Fatalf("LoadCache (reload): %s", err)
+	}
+	pass, ok = reloaded.Lookup("key", 0)
+	if !ok || !pass {
+		t.Fatalf("Lookup after reload: got (%v, %v), want (true, true)", pass, ok)
+	}
+}
+
+func TestCacheLookupExpiry(t *testing.T) {
+	c := &Cache{Entries: map[string]CacheEntry{}, BadSingletons: map[string]time.Time{}}
+	c.Entries["key"] = CacheEntry{Pass: true, Time: time.Now().Add(-time.Hour)}
+
+	if _, ok := c.Lookup("key", time.Minute); ok {
+		t.Fatalf("Lookup returned ok=true for an entry older than ttl")
+	}
+	if pass, ok := c.Lookup("key", time.Hour*2); !ok || !pass {
+		t.Fatalf("Lookup returned (%v, %v) for an entry within ttl, want (true, true)", pass, ok)
+	}
+	if pass, ok := c.Lookup("key", 0); !ok || !pass {
+		t.Fatalf("Lookup with ttl=0 returned (%v, %v), want (true, true)", pass, ok)
+	}
+}
+
+func TestCacheBadSingletons(t *testing.T) {
+	c := &Cache{Entries: map[string]CacheEntry{}, BadSingletons: map[string]time.Time{}}
+
+	if c.IsBad("a.example.com/a", "v1.4.0") {
+		t.Fatalf("IsBad returned true before MarkBad")
+	}
+	c.MarkBad("a.example.com/a", "v1.4.0")
+	if !c.IsBad("a.example.com/a", "v1.4.0") {
+		t.Fatalf("IsBad returned false after MarkBad")
+	}
+	if c.IsBad("a.example.com/a", "v1.5.0") {
+		t.Fatalf("IsBad returned true for a different version")
+	}
+}
+
+func TestCacheKeyOrderIndependent(t *testing.T) {
+	a := []*modfile.Require{
+		{Mod: module.Version{Path: "a.example.com/a", Version: "v1.1.0"}},
+		{Mod: module.Version{Path: "b.example.com/b", Version: "v1.1.0"}},
+	}
+	b := []*modfile.Require{a[1], a[0]}
+
+	if CacheKey("go test ./...", "sum", a) != CacheKey("go test ./...", "sum", b) {
+		t.Fatalf("CacheKey is sensitive to update order")
+	}
+	if CacheKey("go test ./...", "sum", a) == CacheKey("go test ./... -v", "sum", a) {
+		t.Fatalf("CacheKey did not change with test command")
+	}
+	if CacheKey("go test ./...", "sum", a) == CacheKey("go test ./...", "other-sum", a) {
+		t.Fatalf("CacheKey did not change with fingerprint")
+	}
+}
+
+// TestRunnerTryUsesCache verifies that try() consults the cache before
+// calling into Go.Test, and that a known-bad singleton is recorded so later
+// runs can skip it without testing.
+func TestRunnerTryUsesCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goupdate-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	originalMod := writeTestModFile(t, dir, map[string]string{"a.example.com/a": "v1.0.0"})
+
+	g := &mockGo{failOn: map[string]string{"a.example.com/a": "v1.1.0"}}
+	cache := &Cache{Entries: map[string]CacheEntry{}, BadSingletons: map[string]time.Time{}}
+	r := Runner{RootDir: dir, OriginalMod: originalMod, Go: g, Cache: cache, Reporter: NewTextReporter()}
+
+	updates := []*modfile.Require{{Mod: module.Version{Path: "a.example.com/a", Version: "v1.1.0"}}}
+
+	got, err := r.try(updates, "")
+	if err != nil {
+		t.Fatalf("try: %s", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %d surviving updates, want 0", len(got))
+	}
+	if !cache.IsBad("a.example.com/a", "v1.1.0") {
+		t.Fatalf("cache does not know a.example.com/a@v1.1.0 is bad after try() failed it")
+	}
+
+	testCallsAfterFirstTry := g.testCalls
+	got, err = r.try(updates, "")
+	if err != nil {
+		t.Fatalf("try (second call): %s", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("got %d surviving updates on cached retry, want 0", len(got))
+	}
+	if g.testCalls != testCallsAfterFirstTry {
+		t.Fatalf("try() invoked Go.Test again instead of using the cache")
+	}
+}
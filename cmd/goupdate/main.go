@@ -0,0 +1,54 @@
+// Command goupdate upgrades a module's dependencies and bisects test
+// failures to find the largest set of upgrades that still passes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/crewjam/goupdate"
+)
+
+func main() {
+	r := goupdate.NewRunner()
+	flag.StringVar(&r.TestCommand, "test", "go test ./...", "The command that evaluates if an update works")
+	flag.StringVar(&r.RootDir, "c", ".", "The root directory of the module to update")
+	flag.BoolVar(&r.DoCommit, "commit", false, "Commit changes")
+	flag.StringVar(&r.CommitMode, "commit-mode", "single", "How to commit changes: single (one commit for everything) or per-module (one commit per upgrade, on a dedicated branch)")
+	flag.StringVar(&r.Branch, "branch", "", "Branch name for -commit-mode=per-module (default goupdate/YYYYMMDD)")
+	flag.BoolVar(&r.DoPR, "pr", false, "Open a pull/merge request for -commit-mode=per-module via gh or glab")
+	flag.BoolVar(&r.Verbose, "v", false, "Show output of test runs")
+	flag.StringVar(&r.Only, "only", "", "Only consider modules matching this path.Match pattern")
+	flag.StringVar(&r.Exclude, "exclude", "", "Exclude modules matching this path.Match pattern")
+	max := flag.String("max", "major", "Largest version bump to allow: patch, minor, or major")
+	flag.BoolVar(&r.AllowPrerelease, "allow-prerelease", false, "Allow upgrading to a prerelease version")
+	flag.BoolVar(&r.AllowPseudo, "allow-pseudo", false, "Allow upgrading to a pseudo-version")
+	flag.IntVar(&r.Concurrency, "j", 1, "Number of bisection attempts to test concurrently")
+	flag.BoolVar(&r.NoCache, "no-cache", false, "Disable the persistent result cache")
+	flag.DurationVar(&r.CacheTTL, "cache-ttl", 0, "How long cached results remain valid (0 means they never expire)")
+	format := flag.String("format", "text", "Output format: text or json")
+	flag.Parse()
+
+	bump, err := goupdate.ParseBump(*max)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	r.MaxBump = bump
+
+	switch *format {
+	case "text":
+		r.Reporter = goupdate.NewTextReporter()
+	case "json":
+		r.Reporter = goupdate.NewJSONReporter()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -format %q: want text or json\n", *format)
+		os.Exit(1)
+	}
+
+	if err := r.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,83 @@
+package goupdate
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+
+	"golang.org/x/mod/module"
+)
+
+// Go abstracts the subset of the go toolchain that Runner relies on, so that
+// callers can substitute a mock implementation when testing the bisection
+// logic without a real Go toolchain, network access, or module cache.
+type Go interface {
+	// ModTidy runs `go mod tidy` in rootDir.
+	ModTidy(rootDir string) error
+
+	// ModDownload fetches each of mods into the module cache and records a
+	// go.sum entry for it, by running `go get` on them in rootDir (`go mod
+	// download module@version` downloads the module but, for a module that
+	// isn't already a go.mod requirement, leaves go.sum untouched, so it
+	// can't be used for this). Run before testing a candidate set written
+	// directly to go.mod, since that write bypasses the usual `go get` flow
+	// that would otherwise have kept go.sum in sync, and the default
+	// -mod=readonly build fails on a go.sum that's missing an entry.
+	ModDownload(rootDir string, mods []module.Version) error
+
+	// ListUpdates runs `go list -m -u -json all` in rootDir and returns its
+	// raw output, a stream of concatenated (not array-wrapped) JSON objects.
+	ListUpdates(rootDir string) ([]byte, error)
+
+	// Test runs testCommand in rootDir and reports whether it exited
+	// successfully. If verbose is true, the command's output is copied to
+	// os.Stdout/os.Stderr.
+	Test(rootDir, testCommand string, verbose bool) (bool, error)
+}
+
+// execGo is the default Go implementation, which shells out to the real go
+// toolchain.
+type execGo struct{}
+
+func (execGo) ModTidy(rootDir string) error {
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = rootDir
+	return cmd.Run()
+}
+
+func (execGo) ModDownload(rootDir string, mods []module.Version) error {
+	if len(mods) == 0 {
+		return nil
+	}
+	args := []string{"get"}
+	for _, m := range mods {
+		args = append(args, m.Path+"@"+m.Version)
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir = rootDir
+	return cmd.Run()
+}
+
+func (execGo) ListUpdates(rootDir string) ([]byte, error) {
+	cmd := exec.Command("go", "list", "-m", "-u", "-json", "all")
+	cmd.Dir = rootDir
+	return cmd.Output()
+}
+
+func (execGo) Test(rootDir, testCommand string, verbose bool) (bool, error) {
+	cmd := exec.Command("/bin/sh", "-c", testCommand)
+	cmd.Dir = rootDir
+	if verbose {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -1,96 +1,248 @@
-package main
+// Package goupdate implements the logic behind the goupdate tool: it
+// upgrades a module's dependencies and uses a bisection search to find the
+// largest set of upgrades that still passes the caller's test suite.
+//
+// The toolchain operations (go mod tidy, go list, running tests) are
+// abstracted behind the Go interface so that callers can embed the update
+// logic in their own tools and exercise try/bisect/discoverUpdates in tests
+// without a real Go toolchain or network access.
+package goupdate
 
 import (
-	"errors"
-	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/fatih/color"
 	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
 )
 
-func main() {
-	r := Runner{}
-	flag.StringVar(&r.TestCommand, "test", "go test ./...", "The command that evaluates if an update works")
-	flag.StringVar(&r.RootDir, "c", ".", "The root directory of the module to update")
-	flag.BoolVar(&r.DoCommit, "commit", false, "Commit changes")
-	flag.BoolVar(&r.Verbose, "v", false, "Show output of test runs")
-	flag.Parse()
-
-	if err := r.Run(); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
-	}
-}
-
-// Runner holds the state for an update run
+// Runner holds the state for an update run.
 type Runner struct {
 	RootDir     string
 	TestCommand string
 	DoCommit    bool
 	Verbose     bool
 	OriginalMod *modfile.File
+
+	// CommitMode selects how DoCommit applies its commits. "" or "single"
+	// produces one "Update go.mod" commit covering every upgrade, as
+	// before. "per-module" checks out a dedicated branch and commits each
+	// successful upgrade independently.
+	CommitMode string
+
+	// Branch is the branch name used by CommitMode "per-module". Defaults
+	// to goupdate/YYYYMMDD.
+	Branch string
+
+	// DoPR opens a pull/merge request for Branch after a "per-module"
+	// commit run, via gh or glab.
+	DoPR bool
+
+	// Only, if set, is a path.Match pattern; only modules whose path
+	// matches it are considered for upgrade.
+	Only string
+
+	// Exclude, if set, is a path.Match pattern; modules whose path
+	// matches it are never considered for upgrade.
+	Exclude string
+
+	// MaxBump is the largest ordinary version bump (patch/minor/major) that
+	// will be considered for upgrade. NewRunner sets it to BumpMajor (no
+	// limit); the zero value, BumpPatch, allows only patch bumps.
+	MaxBump Bump
+
+	// AllowPrerelease allows upgrading to a prerelease version.
+	AllowPrerelease bool
+
+	// AllowPseudo allows upgrading to a pseudo-version.
+	AllowPseudo bool
+
+	// Concurrency bounds how many test() invocations may run at once when
+	// bisecting a failing update set. Defaults to 1 (sequential).
+	Concurrency int
+
+	// NoCache disables the persistent result cache: every candidate set is
+	// tested for real, and no results are recorded.
+	NoCache bool
+
+	// CachePath overrides where the result cache is stored. If empty,
+	// DefaultCachePath(RootDir) is used.
+	CachePath string
+
+	// CacheTTL is how long a cached result remains valid. Zero means
+	// cached results never expire.
+	CacheTTL time.Duration
+
+	// Cache is the loaded result cache. It is populated by Run from
+	// CachePath/NoCache, but callers may also set it directly (e.g. in
+	// tests) to skip the load step.
+	Cache *Cache
+
+	// Reporter receives progress events as Run executes. Defaults to a
+	// TextReporter, which prints colored, human-readable progress to
+	// stdout; callers that want machine-readable output substitute a
+	// JSONReporter.
+	Reporter Reporter
+
+	// Go is the toolchain implementation used to perform updates and run
+	// tests. It defaults to execGo, which shells out to the real go
+	// command; tests substitute a mock.
+	Go Go
+
+	// semaphore bounds concurrent attempts; lazily created by acquire.
+	semaphore chan struct{}
+
+	// cacheFingerprint is a digest of go.sum, computed once per Run so that
+	// every try() call in the bisection tree hashes against the same value.
+	cacheFingerprint string
+
+	// majorVersionRewrites maps a candidate Require whose module path was
+	// rewritten to carry a new major-version suffix (/v2, /v3, ...) back to
+	// its pre-rewrite path, so setVersions can drop the old require instead
+	// of leaving both behind. Populated once per Run, before try begins.
+	majorVersionRewrites map[*modfile.Require]string
+}
+
+// NewRunner returns a Runner configured to shell out to the real go
+// toolchain, with no bump size limit and no bisection concurrency.
+func NewRunner() *Runner {
+	return &Runner{Go: execGo{}, Reporter: NewTextReporter(), MaxBump: BumpMajor, Concurrency: 1}
 }
 
 func (r *Runner) Run() error {
+	if r.Go == nil {
+		r.Go = execGo{}
+	}
+	if r.Reporter == nil {
+		r.Reporter = NewTextReporter()
+	}
+	if r.semaphore == nil {
+		n := r.Concurrency
+		if n < 1 {
+			n = 1
+		}
+		r.semaphore = make(chan struct{}, n)
+	}
+	if r.Cache == nil && !r.NoCache {
+		cachePath := r.CachePath
+		if cachePath == "" {
+			cachePath = DefaultCachePath(r.RootDir)
+		}
+		cache, err := LoadCache(cachePath)
+		if err != nil {
+			return fmt.Errorf("loading update cache: %w", err)
+		}
+		r.Cache = cache
+	}
+	r.cacheFingerprint = GoSumFingerprint(r.RootDir)
+
 	var err error
 	r.OriginalMod, err = r.readModFile()
 	if err != nil {
 		return err
 	}
+	origModBuf, err := ioutil.ReadFile(filepath.Join(r.RootDir, "go.mod"))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		newModBuf, _ := ioutil.ReadFile(filepath.Join(r.RootDir, "go.mod"))
+		if err := r.Reporter.Finish(modDiff(origModBuf, newModBuf)); err != nil {
+			fmt.Fprintln(os.Stderr, "writing report:", err)
+		}
+	}()
 
 	initialTestPassed, err := r.test()
 	if err != nil {
 		return err
 	}
+	r.Reporter.InitialTest(initialTestPassed)
 	if !initialTestPassed {
-		fmt.Printf("%s\n", color.RedString("test failed before upgrading anything, aborting."))
 		return nil
 	}
 
-	if err := r.updateAll(); err != nil {
-		_ = r.writeModFile(r.OriginalMod)
+	updates, skipped, err := r.discoverUpdates()
+	if err != nil {
 		return err
 	}
+	for _, s := range skipped {
+		r.Reporter.Skipped(s)
+	}
 
-	allUpdatesMod, err := r.readModFile()
-	if err != nil {
-		_ = r.writeModFile(r.OriginalMod)
-		return err
+	if len(updates) == 0 {
+		r.Reporter.UpToDate()
+		return nil
 	}
 
-	// build the original list of updates from the changed made to the mod file
-	updates := []*modfile.Require{}
-	for _, req := range allUpdatesMod.Require {
-		if req.Indirect {
-			continue
-		}
-		if requiredVersion(r.OriginalMod, req.Mod.Path) == req.Mod.Version {
-			continue
+	// record the pre-upgrade version of each candidate, and the pre-upgrade
+	// module path for any candidate that needs a major version path rewrite
+	// (/v2, /v3, ...). The path rewrite itself is only computed here, not
+	// applied to the source tree: req.Mod.Path is updated so both
+	// ModDownload and try fetch/write the right candidate path, but
+	// r.OriginalMod and the tree's imports are left untouched until the
+	// upgrade survives bisection below, so a rejected major bump has
+	// nothing to revert.
+	oldVersions := map[*modfile.Require]string{}
+	r.majorVersionRewrites = map[*modfile.Require]string{}
+	for _, req := range updates {
+		oldVersions[req] = requiredVersion(r.OriginalMod, req.Mod.Path)
+		if classifyBump(oldVersions[req], req.Mod.Version) == BumpMajor {
+			newPath, ok, err := majorVersionPath(req)
+			if err != nil {
+				return fmt.Errorf("rewriting major version for %s: %w", req.Mod.Path, err)
+			}
+			if ok {
+				r.majorVersionRewrites[req] = req.Mod.Path
+				req.Mod.Path = newPath
+			}
 		}
-		updates = append(updates, req)
 	}
 
-	if len(updates) == 0 {
-		fmt.Printf("%s\n", color.GreenString("all packages are up to date"))
-		return nil
+	// download the candidates now, so go.sum has entries for them before
+	// try starts writing their versions directly into go.mod; otherwise a
+	// default -mod=readonly build rejects every candidate as "missing
+	// go.sum entry". This must run after the major version rewrite above:
+	// for a /vN candidate, go.mod and go.sum need the new path, and
+	// fetching the old path at the new version fails outright ("module
+	// path must match major version").
+	mods := make([]module.Version, len(updates))
+	for i, req := range updates {
+		mods[i] = req.Mod
+	}
+	if err := r.Go.ModDownload(r.RootDir, mods); err != nil {
+		return fmt.Errorf("downloading candidate modules: %w", err)
 	}
 
 	goodUpdates, err := r.try(updates, "")
+	if r.Cache != nil {
+		if saveErr := r.Cache.Save(); saveErr != nil {
+			fmt.Printf("%s: %v\n", color.YellowString("failed to save update cache"), saveErr)
+		}
+	}
 	if err != nil {
 		_ = r.writeModFile(r.OriginalMod)
 		return err
 	}
 
+	// only now, with bisection settled, rewrite the imports for the major
+	// bumps that actually survived
+	for _, req := range goodUpdates {
+		if oldPath, ok := r.majorVersionRewrites[req]; ok {
+			if err := rewriteImports(r.RootDir, oldPath, req.Mod.Path); err != nil {
+				_ = r.writeModFile(r.OriginalMod)
+				return fmt.Errorf("rewriting imports for %s: %w", req.Mod.Path, err)
+			}
+		}
+	}
+
 	// rewrite the mod file with the updated packages
 	mod := copyMod(r.OriginalMod)
-	setVersions(mod, goodUpdates)
+	setVersions(mod, goodUpdates, r.majorVersionRewrites)
 	if err := r.writeModFile(mod); err != nil {
 		_ = r.writeModFile(r.OriginalMod)
 		return err
@@ -100,159 +252,150 @@ func (r *Runner) Run() error {
 	if err != nil {
 		return err
 	}
+	r.Reporter.FinalTest(finalTestPassed)
 	if !finalTestPassed {
-		fmt.Printf("%s\n", color.RedString("test failed after applying upgrades, aborting."))
 		return nil
 	}
 
 	for _, req := range updates {
+		status := "failed"
 		if requiredVersion(&modfile.File{Require: goodUpdates}, req.Mod.Path) != "" {
-			fmt.Printf("%s: %s %s\n", color.GreenString("package upgraded"), req.Mod.Path, req.Mod.Version)
-		}
-	}
-	for _, req := range updates {
-		if requiredVersion(&modfile.File{Require: goodUpdates}, req.Mod.Path) == "" {
-			fmt.Printf("%s: %s %s\n", color.RedString("package upgrade failed"), req.Mod.Path, req.Mod.Version)
+			status = "upgraded"
 		}
+		r.Reporter.Candidate(req.Mod.Path, oldVersions[req], req.Mod.Version, status)
 	}
 
-	{
-		cmd := exec.Command("go", "mod", "tidy")
-		cmd.Dir = r.RootDir
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("go mod tidy failed: %v", err)
-		}
+	if err := r.Go.ModTidy(r.RootDir); err != nil {
+		return fmt.Errorf("go mod tidy failed: %v", err)
 	}
 
 	if r.DoCommit {
-		goodUpdateCount := 0
-		message := []string{"Update go.mod", ""}
-		for _, req := range updates {
-			if requiredVersion(&modfile.File{Require: goodUpdates}, req.Mod.Path) != "" {
-				message = append(message, fmt.Sprintf("* upgrade %s from %s to %s",
-					req.Mod.Path, requiredVersion(r.OriginalMod, req.Mod.Path), req.Mod.Version))
-				goodUpdateCount++
-			} else {
-				message = append(message, fmt.Sprintf("* FAILED upgrade %s from %s to %s",
-					req.Mod.Path, requiredVersion(r.OriginalMod, req.Mod.Path), req.Mod.Version))
-			}
-		}
-
-		if goodUpdateCount > 0 {
-			cmd := exec.Command("git", "-C", r.RootDir, "add", "-A")
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			cmd.Dir = r.RootDir
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("git add failed: %v", err)
+		switch r.CommitMode {
+		case "", "single":
+			if err := r.commitSingle(updates, goodUpdates, oldVersions, skipped); err != nil {
+				return err
 			}
-			cmd = exec.Command("git", "commit", "-m", strings.Join(message, "\n"))
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			cmd.Dir = r.RootDir
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("git commit failed: %v", err)
+		case "per-module":
+			if err := r.commitPerModule(updates, goodUpdates, oldVersions); err != nil {
+				return err
 			}
+		default:
+			return fmt.Errorf("unknown commit mode %q", r.CommitMode)
 		}
 	}
 
 	return nil
 }
 
-func (r Runner) updateAll() error {
-	fmt.Printf("running go get -u ./...\n")
-	cmd := exec.Command("go", "get", "-u", "./...")
-	outputReader, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	cmd.Stderr = cmd.Stdout
-	cmd.Dir = r.RootDir
-	if err := cmd.Run(); err != nil {
-		_, _ = io.Copy(os.Stdout, outputReader)
-		return fmt.Errorf("go get -u ./...: %s", err)
-	}
-	return nil
-}
-
 // try tries to apply `updates` by performing the update and running the test. If the
 // tests fail, it invokes itself recursively with a smaller set of updates. Returns a list of
 // the updates that passed the test.
 func (r Runner) try(updates []*modfile.Require, indent string) ([]*modfile.Require, error) {
-	fmt.Printf("%strying %d updates\n", indent, len(updates))
-	for _, req := range updates {
-		fmt.Printf("%s  %s: %s -> %s\n", indent, req.Mod.Path, requiredVersion(r.OriginalMod, req.Mod.Path), req.Mod.Version)
-	}
+	originalVersion := func(path string) string { return requiredVersion(r.OriginalMod, path) }
+	r.Reporter.Attempting(indent, updates, originalVersion)
 
 	if len(updates) == 0 {
 		return nil, nil
 	}
 
 	mod := copyMod(r.OriginalMod)
-	setVersions(mod, updates)
+	setVersions(mod, updates, r.majorVersionRewrites)
 	err := r.writeModFile(mod)
 	if err != nil {
 		return nil, err
 	}
 
-	ok, err := r.test()
-	if err != nil {
-		return nil, err
+	start := time.Now()
+	var cacheKey string
+	var ok bool
+	cacheHit := false
+	if r.Cache != nil {
+		cacheKey = CacheKey(r.TestCommand, r.cacheFingerprint, updates)
+		if pass, hit := r.Cache.Lookup(cacheKey, r.CacheTTL); hit {
+			ok, cacheHit = pass, true
+		}
+	}
+	if !cacheHit {
+		ok, err = r.test()
+		if err != nil {
+			return nil, err
+		}
+		if r.Cache != nil {
+			r.Cache.Store(cacheKey, ok)
+		}
 	}
+	r.Reporter.AttemptResult(indent, updates, ok, cacheHit, time.Since(start))
 	if ok {
-		fmt.Printf("%s  test passed\n", indent)
 		return updates, nil
 	}
 
-	fmt.Printf("%s  test failed\n", indent)
-
 	// if we are testing only one package, and it fails, then this package
 	// is bad, and we shouldn't include it in the update
 	if len(updates) == 1 {
+		if r.Cache != nil {
+			r.Cache.MarkBad(updates[0].Mod.Path, updates[0].Mod.Version)
+		}
 		return []*modfile.Require{}, nil
 	}
 
 	// more than one package was being updated, so we split the updates in half
-	// and try them separately, to see if we can figure out which ones are actually
-	// broken
+	// and try them separately, to see if we can figure out which ones are
+	// actually broken.
 	requireA, requireB := bisect(updates)
-
-	successA, err := r.try(requireA, indent+"  ")
-	if err != nil {
-		return nil, err
-	}
-	successB, err := r.try(requireB, indent+"  ")
-	if err != nil {
-		return nil, err
+	halves := [][]*modfile.Require{requireA, requireB}
+	results := make([][]*modfile.Require, 2)
+	errs := make([]error, 2)
+
+	if r.Concurrency > 1 {
+		// each half gets its own worktree (or directory copy) so the two
+		// halves can be tested concurrently, bounded by Concurrency.
+		// Forking is only safe (and only worth the worktree overhead) when
+		// more than one test can actually run at once: at Concurrency 1 it
+		// would test stale HEAD source against a working tree that may
+		// carry uncommitted changes, disagreeing with the top-level try
+		// that tests RootDir directly.
+		var wg sync.WaitGroup
+		for i, half := range halves {
+			wg.Add(1)
+			go func(i int, half []*modfile.Require) {
+				defer wg.Done()
+
+				attempt, cleanup, err := r.newAttempt()
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				defer cleanup()
+
+				results[i], errs[i] = attempt.try(half, indent+"  ")
+			}(i, half)
+		}
+		wg.Wait()
+	} else {
+		for i, half := range halves {
+			results[i], errs[i] = r.try(half, indent+"  ")
+		}
 	}
 
-	goodUpdates := append(successA, successB...)
-	fmt.Printf("%skeeping %d of %d updates:\n", indent, len(goodUpdates), len(updates))
-	for _, req := range goodUpdates {
-		fmt.Printf("%s  %s: %s -> %s\n", indent, req.Mod.Path,
-			requiredVersion(r.OriginalMod, req.Mod.Path), req.Mod.Version)
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	goodUpdates := append(results[0], results[1]...)
+	r.Reporter.Bisected(indent, goodUpdates, len(updates), originalVersion)
+
 	return goodUpdates, nil
 }
 
-// test runs the tests to determine if an upgrade was successful
-func (r Runner) test() (bool, error) {
-	cmd := exec.Command("/bin/sh", "-c", r.TestCommand)
-	cmd.Dir = r.RootDir
-	if r.Verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	err := cmd.Run()
-	var exitErr *exec.ExitError
-	if errors.As(err, &exitErr) {
-		return false, nil
-	}
-	if err != nil {
-		return false, fmt.Errorf("cannot run test program: %s", err)
-	}
-	return true, nil
+// test runs the tests to determine if an upgrade was successful. It
+// acquires a concurrency slot for the duration of the run, so that at most
+// Concurrency tests run at once across a bisection's worktree attempts.
+func (r *Runner) test() (bool, error) {
+	release := r.acquire()
+	defer release()
+	return r.Go.Test(r.RootDir, r.TestCommand, r.Verbose)
 }
 
 // readModFile reads and parses go.mod
@@ -289,9 +432,16 @@ func bisect(updates []*modfile.Require) ([]*modfile.Require, []*modfile.Require)
 }
 
 // setVersions updates the requirements in `mf` with the updates described
-// by `updates`.
-func setVersions(mf *modfile.File, updates []*modfile.Require) {
+// by `updates`. majorVersionRewrites maps a require whose module path was
+// rewritten to carry a new major-version suffix back to its pre-rewrite
+// path; for those, the old path's require is dropped first so the two
+// don't both end up in mf. Pass nil if none of updates carry a rewritten
+// path.
+func setVersions(mf *modfile.File, updates []*modfile.Require, majorVersionRewrites map[*modfile.Require]string) {
 	for _, req := range updates {
+		if oldPath, ok := majorVersionRewrites[req]; ok {
+			_ = mf.DropRequire(oldPath)
+		}
 		_ = mf.AddRequire(req.Mod.Path, req.Mod.Version) // AddRequire cannot fail
 	}
 }
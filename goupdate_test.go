@@ -0,0 +1,171 @@
+package goupdate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func writeTestModFile(t *testing.T, dir string, requires map[string]string) *modfile.File {
+	t.Helper()
+
+	mf := &modfile.File{}
+	if err := mf.AddModuleStmt("example.com/under-test"); err != nil {
+		t.Fatalf("AddModuleStmt: %s", err)
+	}
+	for path, version := range requires {
+		if err := mf.AddRequire(path, version); err != nil {
+			t.Fatalf("AddRequire: %s", err)
+		}
+	}
+	buf, err := mf.Format()
+	if err != nil {
+		t.Fatalf("Format: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), buf, 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	return mf
+}
+
+func TestRunnerTry(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates map[string]string // path -> new version
+		failOn  map[string]string
+		want    map[string]string // path -> version expected to survive
+	}{
+		{
+			name:    "all pass",
+			updates: map[string]string{"a.example.com/a": "v1.1.0", "b.example.com/b": "v1.1.0"},
+			failOn:  map[string]string{},
+			want:    map[string]string{"a.example.com/a": "v1.1.0", "b.example.com/b": "v1.1.0"},
+		},
+		{
+			name:    "single bad update dropped",
+			updates: map[string]string{"a.example.com/a": "v1.1.0", "b.example.com/b": "v1.1.0"},
+			failOn:  map[string]string{"b.example.com/b": "v1.1.0"},
+			want:    map[string]string{"a.example.com/a": "v1.1.0"},
+		},
+		{
+			name: "bisection narrows down a single bad update among several good ones",
+			updates: map[string]string{
+				"a.example.com/a": "v1.1.0",
+				"b.example.com/b": "v1.1.0",
+				"c.example.com/c": "v1.1.0",
+				"d.example.com/d": "v1.1.0",
+			},
+			failOn: map[string]string{"c.example.com/c": "v1.1.0"},
+			want: map[string]string{
+				"a.example.com/a": "v1.1.0",
+				"b.example.com/b": "v1.1.0",
+				"d.example.com/d": "v1.1.0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "goupdate-test")
+			if err != nil {
+				t.Fatalf("TempDir: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			original := map[string]string{}
+			for path := range tt.updates {
+				original[path] = "v1.0.0"
+			}
+			originalMod := writeTestModFile(t, dir, original)
+
+			g := &mockGo{failOn: tt.failOn}
+			r := Runner{RootDir: dir, OriginalMod: originalMod, Go: g, Reporter: NewTextReporter()}
+
+			updates := []*modfile.Require{}
+			for path, version := range tt.updates {
+				updates = append(updates, &modfile.Require{
+					Mod: module.Version{Path: path, Version: version},
+				})
+			}
+
+			got, err := r.try(updates, "")
+			if err != nil {
+				t.Fatalf("try: %s", err)
+			}
+
+			gotVersions := map[string]string{}
+			for _, req := range got {
+				gotVersions[req.Mod.Path] = req.Mod.Version
+			}
+			if len(gotVersions) != len(tt.want) {
+				t.Fatalf("got %d surviving updates, want %d: %v", len(gotVersions), len(tt.want), gotVersions)
+			}
+			for path, version := range tt.want {
+				if gotVersions[path] != version {
+					t.Errorf("update %s: got version %q, want %q", path, gotVersions[path], version)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerRunDownloadsCandidatesBeforeTry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goupdate-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestModFile(t, dir, map[string]string{"a.example.com/a": "v1.0.0"})
+
+	g := &mockGo{listUpdatesOutput: []byte(`{"Path":"a.example.com/a","Version":"v1.0.0","Update":{"Path":"a.example.com/a","Version":"v1.1.0"}}`)}
+	r := &Runner{RootDir: dir, TestCommand: "true", Go: g, Reporter: NewTextReporter(), MaxBump: BumpMajor, NoCache: true}
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run: %s", err)
+	}
+
+	if g.downloadCalls != 1 {
+		t.Fatalf("got %d calls to ModDownload, want 1 (go.sum must be populated before try writes a candidate version)", g.downloadCalls)
+	}
+}
+
+// TestRunnerRunDownloadsRewrittenMajorVersionPath guards against ModDownload
+// running before the major-version path rewrite: for a candidate that moves
+// to a /vN path, the fetched module must already be at the new path, or
+// `go get` fails trying to fetch the old path at a version it was never
+// tagged at.
+func TestRunnerRunDownloadsRewrittenMajorVersionPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goupdate-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestModFile(t, dir, map[string]string{"a.example.com/a": "v1.0.0"})
+
+	g := &mockGo{listUpdatesOutput: []byte(`{"Path":"a.example.com/a","Version":"v1.0.0","Update":{"Path":"a.example.com/a","Version":"v2.0.0"}}`)}
+	r := &Runner{RootDir: dir, TestCommand: "true", Go: g, Reporter: NewTextReporter(), MaxBump: BumpMajor, NoCache: true}
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run: %s", err)
+	}
+
+	if len(g.downloadedMods) != 1 || g.downloadedMods[0].Path != "a.example.com/a/v2" {
+		t.Fatalf("got downloaded mods %v, want [{a.example.com/a/v2 v2.0.0}] (ModDownload must run after the major version path rewrite)", g.downloadedMods)
+	}
+}
+
+func TestBisect(t *testing.T) {
+	updates := []*modfile.Require{
+		{Mod: module.Version{Path: "a", Version: "v1"}},
+		{Mod: module.Version{Path: "b", Version: "v1"}},
+		{Mod: module.Version{Path: "c", Version: "v1"}},
+	}
+	a, b := bisect(updates)
+	if len(a)+len(b) != len(updates) {
+		t.Fatalf("bisect dropped updates: got %d + %d, want %d", len(a), len(b), len(updates))
+	}
+}
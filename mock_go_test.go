@@ -0,0 +1,68 @@
+package goupdate
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// mockGo is a Go implementation for tests. It never shells out; Test
+// instead reads the go.mod that Runner already wrote to rootDir and fails
+// whenever a required module is pinned to the version named in failOn,
+// simulating an upgrade that breaks the build. Safe for concurrent use, since
+// Runner may run several attempts' Test calls in parallel.
+type mockGo struct {
+	failOn map[string]string // module path -> version that causes the test to fail
+
+	listUpdatesOutput []byte // canned response for ListUpdates
+
+	mu             sync.Mutex
+	tidyCalls      int
+	testCalls      int
+	downloadCalls  int
+	downloadedMods []module.Version
+}
+
+func (m *mockGo) ModTidy(rootDir string) error {
+	m.mu.Lock()
+	m.tidyCalls++
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *mockGo) ModDownload(rootDir string, mods []module.Version) error {
+	m.mu.Lock()
+	m.downloadCalls++
+	m.downloadedMods = append(m.downloadedMods, mods...)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *mockGo) ListUpdates(rootDir string) ([]byte, error) {
+	return m.listUpdatesOutput, nil
+}
+
+func (m *mockGo) Test(rootDir, testCommand string, verbose bool) (bool, error) {
+	m.mu.Lock()
+	m.testCalls++
+	m.mu.Unlock()
+
+	buf, err := ioutil.ReadFile(filepath.Join(rootDir, "go.mod"))
+	if err != nil {
+		return false, err
+	}
+	mf, err := modfile.Parse(filepath.Join(rootDir, "go.mod"), buf, nil)
+	if err != nil {
+		return false, err
+	}
+
+	for _, req := range mf.Require {
+		if m.failOn[req.Mod.Path] == req.Mod.Version {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,129 @@
+package goupdate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Module mirrors the subset of the JSON object that `go list -m -u -json`
+// emits for a single module that we care about.
+type Module struct {
+	Path     string  // module path
+	Version  string  // module version
+	Indirect bool    // module is only indirectly needed
+	Main     bool    // module is the main module
+	Update   *Module // available update, if any (only Path/Version are set)
+}
+
+// parseModuleList parses the concatenated (not array-wrapped) JSON stream
+// produced by `go list -m -u -json all`.
+func parseModuleList(data []byte) ([]Module, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	modules := []Module{}
+	for {
+		var m Module
+		err := dec.Decode(&m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing go list output: %w", err)
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+// SkippedUpdate records a candidate update that was excluded from the
+// update set before testing, rather than by a failing test: either because
+// policy disallows its bump size, or because the cache already knows it
+// fails on its own.
+type SkippedUpdate struct {
+	Path       string
+	OldVersion string
+	NewVersion string
+	Bump       Bump
+	Reason     string
+
+	// Cached is true if this update was skipped because the cache already
+	// knows it fails on its own, rather than because of policy.
+	Cached bool
+}
+
+// discoverUpdates runs `go list -m -u -json all`, parses the resulting
+// module list, and returns the candidate set of requires to try, after
+// applying the Only and Exclude filters and the MaxBump/AllowPrerelease/
+// AllowPseudo policy. This builds the candidate set directly from what's
+// available upstream, rather than running `go get -u ./...` and diffing
+// go.mod afterwards. Candidates dropped by policy are returned separately
+// so they can be reported distinctly from failed updates.
+func (r Runner) discoverUpdates() ([]*modfile.Require, []SkippedUpdate, error) {
+	if r.Only != "" {
+		if _, err := path.Match(r.Only, ""); err != nil {
+			return nil, nil, fmt.Errorf("invalid -only pattern %q: %w", r.Only, err)
+		}
+	}
+	if r.Exclude != "" {
+		if _, err := path.Match(r.Exclude, ""); err != nil {
+			return nil, nil, fmt.Errorf("invalid -exclude pattern %q: %w", r.Exclude, err)
+		}
+	}
+
+	out, err := r.Go.ListUpdates(r.RootDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("go list -m -u -json all: %w", err)
+	}
+
+	modules, err := parseModuleList(out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updates := []*modfile.Require{}
+	skipped := []SkippedUpdate{}
+	for _, m := range modules {
+		if m.Main || m.Indirect || m.Update == nil {
+			continue
+		}
+
+		if r.Only != "" {
+			if ok, err := path.Match(r.Only, m.Path); err != nil || !ok {
+				continue
+			}
+		}
+		if r.Exclude != "" {
+			if ok, err := path.Match(r.Exclude, m.Path); err == nil && ok {
+				continue
+			}
+		}
+
+		bump := classifyBump(m.Version, m.Update.Version)
+		if !r.policyAllows(bump) {
+			skipped = append(skipped, SkippedUpdate{
+				Path: m.Path, OldVersion: m.Version, NewVersion: m.Update.Version, Bump: bump,
+				Reason: fmt.Sprintf("%s bump not allowed", bump),
+			})
+			continue
+		}
+
+		if r.Cache != nil && r.Cache.IsBad(m.Path, m.Update.Version) {
+			skipped = append(skipped, SkippedUpdate{
+				Path: m.Path, OldVersion: m.Version, NewVersion: m.Update.Version,
+				Reason: "known to fail on its own (cached)", Cached: true,
+			})
+			continue
+		}
+
+		updates = append(updates, &modfile.Require{
+			Mod: module.Version{Path: m.Path, Version: m.Update.Version},
+		})
+	}
+	return updates, skipped, nil
+}
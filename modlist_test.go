@@ -0,0 +1,146 @@
+package goupdate
+
+import "testing"
+
+const sampleModuleList = `{
+	"Path": "example.com/main",
+	"Main": true
+}
+{
+	"Path": "a.example.com/a",
+	"Version": "v1.0.0",
+	"Update": {
+		"Path": "a.example.com/a",
+		"Version": "v1.1.0"
+	}
+}
+{
+	"Path": "b.example.com/b",
+	"Version": "v1.0.0",
+	"Indirect": true,
+	"Update": {
+		"Path": "b.example.com/b",
+		"Version": "v1.1.0"
+	}
+}
+{
+	"Path": "c.example.com/c",
+	"Version": "v1.0.0"
+}
+{
+	"Path": "d.example.com/d",
+	"Version": "v1.0.0",
+	"Update": {
+		"Path": "d.example.com/d",
+		"Version": "v2.0.0"
+	}
+}
+`
+
+func TestParseModuleList(t *testing.T) {
+	modules, err := parseModuleList([]byte(sampleModuleList))
+	if err != nil {
+		t.Fatalf("parseModuleList: %s", err)
+	}
+	if len(modules) != 5 {
+		t.Fatalf("got %d modules, want 5", len(modules))
+	}
+	if !modules[0].Main {
+		t.Errorf("expected first module to be the main module")
+	}
+	if modules[1].Update == nil || modules[1].Update.Version != "v1.1.0" {
+		t.Errorf("got %+v, want an available update to v1.1.0", modules[1])
+	}
+	if !modules[2].Indirect {
+		t.Errorf("expected b.example.com/b to be marked indirect")
+	}
+}
+
+func TestRunnerDiscoverUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		only    string
+		exclude string
+		want    map[string]string
+	}{
+		{
+			name: "no filters",
+			want: map[string]string{
+				"a.example.com/a": "v1.1.0",
+				"d.example.com/d": "v2.0.0",
+			},
+		},
+		{
+			name: "only filters to a single module",
+			only: "a.example.com/*",
+			want: map[string]string{
+				"a.example.com/a": "v1.1.0",
+			},
+		},
+		{
+			name:    "exclude drops a module",
+			exclude: "a.example.com/*",
+			want: map[string]string{
+				"d.example.com/d": "v2.0.0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &mockGo{listUpdatesOutput: []byte(sampleModuleList)}
+			r := Runner{Go: g, Only: tt.only, Exclude: tt.exclude, MaxBump: BumpMajor}
+
+			got, skipped, err := r.discoverUpdates()
+			if err != nil {
+				t.Fatalf("discoverUpdates: %s", err)
+			}
+			if len(skipped) != 0 {
+				t.Fatalf("got %d skipped updates, want 0: %v", len(skipped), skipped)
+			}
+
+			gotVersions := map[string]string{}
+			for _, req := range got {
+				gotVersions[req.Mod.Path] = req.Mod.Version
+			}
+			if len(gotVersions) != len(tt.want) {
+				t.Fatalf("got %d updates, want %d: %v", len(gotVersions), len(tt.want), gotVersions)
+			}
+			for path, version := range tt.want {
+				if gotVersions[path] != version {
+					t.Errorf("update %s: got version %q, want %q", path, gotVersions[path], version)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerDiscoverUpdatesBadPattern(t *testing.T) {
+	g := &mockGo{listUpdatesOutput: []byte(sampleModuleList)}
+
+	r := Runner{Go: g, Only: "[", MaxBump: BumpMajor}
+	if _, _, err := r.discoverUpdates(); err == nil {
+		t.Fatalf("discoverUpdates with a malformed -only pattern: got nil error, want one")
+	}
+
+	r = Runner{Go: g, Exclude: "[", MaxBump: BumpMajor}
+	if _, _, err := r.discoverUpdates(); err == nil {
+		t.Fatalf("discoverUpdates with a malformed -exclude pattern: got nil error, want one")
+	}
+}
+
+func TestRunnerDiscoverUpdatesMaxBump(t *testing.T) {
+	g := &mockGo{listUpdatesOutput: []byte(sampleModuleList)}
+	r := Runner{Go: g, MaxBump: BumpMinor}
+
+	got, skipped, err := r.discoverUpdates()
+	if err != nil {
+		t.Fatalf("discoverUpdates: %s", err)
+	}
+	if len(got) != 1 || got[0].Mod.Path != "a.example.com/a" {
+		t.Fatalf("got %v, want only a.example.com/a to be upgraded", got)
+	}
+	if len(skipped) != 1 || skipped[0].Path != "d.example.com/d" || skipped[0].Bump != BumpMajor {
+		t.Fatalf("got skipped %v, want d.example.com/d skipped as a major bump", skipped)
+	}
+}
@@ -0,0 +1,171 @@
+package goupdate
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// worktreeMu serializes git worktree add/remove calls. Concurrent attempts
+// to add or remove worktrees in the same repository can contend on git's
+// worktree lock and fail spuriously (e.g. "fatal: ... is locked"); git
+// worktree operations are cheap relative to the test runs they enable, so
+// serializing them costs little while bisecting with Concurrency > 1.
+var worktreeMu sync.Mutex
+
+// acquire blocks until a concurrency slot is available and returns a func
+// that releases it. The semaphore is lazily sized from r.Concurrency (at
+// least 1) the first time it's needed, so Runner values built without
+// going through NewRunner still serialize correctly.
+func (r *Runner) acquire() func() {
+	if r.semaphore == nil {
+		n := r.Concurrency
+		if n < 1 {
+			n = 1
+		}
+		r.semaphore = make(chan struct{}, n)
+	}
+	r.semaphore <- struct{}{}
+	return func() { <-r.semaphore }
+}
+
+// newAttempt returns a Runner whose RootDir is an isolated copy of r's
+// RootDir, suitable for testing a subset of updates concurrently with other
+// attempts. It prefers a git worktree (cheap, shares the object store);
+// repositories without git fall back to a plain recursive copy. Only used
+// when Concurrency > 1: try() tests RootDir directly when bisecting
+// sequentially, since forking here has a real cost in accuracy, not just
+// time (see the HEAD caveat below).
+//
+// A git worktree is created against HEAD, not r.RootDir as it stands on
+// disk: any uncommitted source changes besides go.mod/go.sum (which are
+// explicitly overlaid below) are invisible to the attempt. Callers running
+// against a dirty working tree should commit or stash first; otherwise
+// bisection tests a stale tree.
+//
+// The returned cleanup func removes the attempt's directory and must be
+// called once the caller is done with it.
+func (r Runner) newAttempt() (Runner, func(), error) {
+	tmp, err := ioutil.TempDir("", "goupdate-attempt")
+	if err != nil {
+		return Runner{}, nil, err
+	}
+
+	cleanup, err := populateAttemptDir(r.RootDir, tmp)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return Runner{}, nil, err
+	}
+
+	// the worktree/copy reflects the last commit (or r.RootDir's files as
+	// they stood at copy time); overlay the go.mod and go.sum this run has
+	// written so far, so an upgrade already in progress - and the go.sum
+	// entries ModDownload fetched for it - are preserved across the fork.
+	for _, name := range []string{"go.mod", "go.sum"} {
+		if buf, err := ioutil.ReadFile(filepath.Join(r.RootDir, name)); err == nil {
+			_ = ioutil.WriteFile(filepath.Join(tmp, name), buf, 0644)
+		}
+	}
+
+	attempt := r
+	attempt.RootDir = tmp
+	return attempt, cleanup, nil
+}
+
+// populateAttemptDir fills dir (an empty, existing temp directory) with the
+// contents of rootDir, via a git worktree when rootDir is inside a git
+// repository, or a recursive copy otherwise. It returns a cleanup func.
+//
+// git worktree add/remove are serialized across concurrent attempts via
+// worktreeMu: run concurrently (as bisection with Concurrency > 1 does),
+// they can contend on git's worktree lock and fail spuriously.
+func populateAttemptDir(rootDir, dir string) (func(), error) {
+	if isGitRepo(rootDir) {
+		// git worktree add requires the target not to exist yet
+		if err := os.Remove(dir); err != nil {
+			return nil, err
+		}
+
+		worktreeMu.Lock()
+		cmd := exec.Command("git", "worktree", "add", "--detach", "--force", dir, "HEAD")
+		cmd.Dir = rootDir
+		err := cmd.Run()
+		worktreeMu.Unlock()
+
+		if err == nil {
+			return func() {
+				worktreeMu.Lock()
+				rm := exec.Command("git", "worktree", "remove", "--force", dir)
+				rm.Dir = rootDir
+				rmErr := rm.Run()
+				worktreeMu.Unlock()
+				if rmErr != nil {
+					os.RemoveAll(dir)
+				}
+			}, nil
+		}
+		// fall through to a plain copy if worktree creation failed, e.g.
+		// because the module isn't checked into this repository
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := copyDir(rootDir, dir); err != nil {
+		return nil, err
+	}
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// isGitRepo reports whether dir is inside a git working tree.
+func isGitRepo(dir string) bool {
+	cmd := exec.Command("git", "rev-parse", "--is-inside-work-tree")
+	cmd.Dir = dir
+	return cmd.Run() == nil
+}
+
+// copyDir recursively copies src into dst, which must already exist. The
+// .git directory, if any, is skipped.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+		return copyFile(path, target, info.Mode())
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,231 @@
+package goupdate
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// defaultBranchName returns the default -branch value: goupdate/YYYYMMDD.
+func defaultBranchName() string {
+	return "goupdate/" + time.Now().Format("20060102")
+}
+
+// repoHost splits a module path into its host (e.g. "github.com") and the
+// path with any major-version suffix (/v2, /v3, ...) stripped, so it can be
+// turned into a repository URL. ok is false if the path has no host
+// component.
+func repoHost(modulePath string) (host, repoPath string, ok bool) {
+	repoPath = modulePath
+	if base, _, splitOK := module.SplitPathVersion(modulePath); splitOK {
+		repoPath = base
+	}
+	host, _, ok = strings.Cut(repoPath, "/")
+	return host, repoPath, ok
+}
+
+// changelogURL returns a best-effort link comparing oldVersion and
+// newVersion for modulePath, using path heuristics for the common forges.
+// It returns "" for hosts it doesn't recognize.
+func changelogURL(modulePath, oldVersion, newVersion string) string {
+	host, repoPath, ok := repoHost(modulePath)
+	if !ok {
+		return ""
+	}
+	switch host {
+	case "github.com":
+		return fmt.Sprintf("https://%s/compare/%s...%s", repoPath, oldVersion, newVersion)
+	case "gitlab.com":
+		return fmt.Sprintf("https://%s/-/compare/%s...%s", repoPath, oldVersion, newVersion)
+	case "bitbucket.org":
+		return fmt.Sprintf("https://%s/branches/compare/%s%%0D%s", repoPath, newVersion, oldVersion)
+	}
+	return ""
+}
+
+// runGit runs git with args in rootDir, streaming its output to the
+// process's stdout/stderr.
+func runGit(rootDir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = rootDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// commitSingle is the original -commit behavior: one "Update go.mod" commit
+// covering every upgrade, failed upgrade, and policy-skipped candidate.
+func (r Runner) commitSingle(updates, goodUpdates []*modfile.Require, oldVersions map[*modfile.Require]string, skipped []SkippedUpdate) error {
+	goodUpdateCount := 0
+	message := []string{"Update go.mod", ""}
+	for _, req := range updates {
+		if requiredVersion(&modfile.File{Require: goodUpdates}, req.Mod.Path) != "" {
+			message = append(message, fmt.Sprintf("* upgrade %s from %s to %s",
+				req.Mod.Path, oldVersions[req], req.Mod.Version))
+			goodUpdateCount++
+		} else {
+			message = append(message, fmt.Sprintf("* FAILED upgrade %s from %s to %s",
+				req.Mod.Path, oldVersions[req], req.Mod.Version))
+		}
+	}
+	for _, s := range skipped {
+		message = append(message, fmt.Sprintf("* SKIPPED upgrade %s from %s to %s (%s)",
+			s.Path, s.OldVersion, s.NewVersion, s.Reason))
+	}
+
+	if goodUpdateCount == 0 {
+		return nil
+	}
+
+	if err := runGit(r.RootDir, "add", "-A"); err != nil {
+		return fmt.Errorf("git add failed: %v", err)
+	}
+	if err := runGit(r.RootDir, "commit", "-m", strings.Join(message, "\n")); err != nil {
+		return fmt.Errorf("git commit failed: %v", err)
+	}
+	return nil
+}
+
+// commitPerModule implements -commit-mode=per-module: it checks out a
+// dedicated branch, then commits each successful upgrade independently,
+// re-running `go mod tidy` and the test suite for that upgrade alone (in
+// isolation, against the pristine base go.mod) so a later human bisect only
+// has to look at one commit per broken module. If a module passed as part
+// of the batch that try() settled on, but fails when applied by itself,
+// that's a real dependency between upgrades rather than an independent
+// one; such modules are collected and committed together in a single
+// fallback commit instead.
+//
+// Each commit's go.mod is cumulative: it carries every upgrade already
+// committed on this branch plus the current one, so the branch HEAD ends
+// with the union of every successful upgrade, not just the last one. Only
+// the isolation test run ahead of each commit uses the single-module
+// go.mod; that's solely to decide whether the module is independent.
+func (r Runner) commitPerModule(updates, goodUpdates []*modfile.Require, oldVersions map[*modfile.Require]string) error {
+	branch := r.Branch
+	if branch == "" {
+		branch = defaultBranchName()
+	}
+	if err := runGit(r.RootDir, "checkout", "-b", branch); err != nil {
+		return fmt.Errorf("creating branch %s: %w", branch, err)
+	}
+
+	var applied, conflicts []*modfile.Require
+	for _, req := range updates {
+		if requiredVersion(&modfile.File{Require: goodUpdates}, req.Mod.Path) == "" {
+			continue // didn't survive bisection
+		}
+
+		isolated := copyMod(r.OriginalMod)
+		setVersions(isolated, []*modfile.Require{req}, r.majorVersionRewrites)
+		if err := r.writeModFile(isolated); err != nil {
+			return err
+		}
+		if err := r.Go.ModTidy(r.RootDir); err != nil {
+			return fmt.Errorf("go mod tidy for %s: %w", req.Mod.Path, err)
+		}
+
+		ok, err := r.test()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			conflicts = append(conflicts, req)
+			continue
+		}
+
+		applied = append(applied, req)
+		cumulative := copyMod(r.OriginalMod)
+		setVersions(cumulative, applied, r.majorVersionRewrites)
+		if err := r.writeModFile(cumulative); err != nil {
+			return err
+		}
+		if err := r.Go.ModTidy(r.RootDir); err != nil {
+			return fmt.Errorf("go mod tidy for %s: %w", req.Mod.Path, err)
+		}
+
+		if err := r.commitOne(req.Mod.Path, oldVersions[req], req.Mod.Version); err != nil {
+			return err
+		}
+	}
+
+	if len(conflicts) > 0 {
+		if err := r.commitConflicts(applied, conflicts, oldVersions); err != nil {
+			return err
+		}
+	}
+
+	if r.DoPR {
+		if err := r.createPR(branch); err != nil {
+			return fmt.Errorf("creating pull request: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// commitOne commits the go.mod state already written for a single upgrade.
+func (r Runner) commitOne(path, oldVersion, newVersion string) error {
+	if err := runGit(r.RootDir, "add", "-A"); err != nil {
+		return fmt.Errorf("git add for %s: %w", path, err)
+	}
+	message := fmt.Sprintf("Upgrade %s from %s to %s", path, oldVersion, newVersion)
+	if url := changelogURL(path, oldVersion, newVersion); url != "" {
+		message += "\n\n" + url
+	}
+	if err := runGit(r.RootDir, "commit", "-m", message); err != nil {
+		return fmt.Errorf("git commit for %s: %w", path, err)
+	}
+	return nil
+}
+
+// commitConflicts writes and commits every update in conflicts together, on
+// top of applied (every module already committed independently earlier in
+// commitPerModule): each of these passed as part of the bisected batch but
+// failed when applied on its own, so they can't be split into independent
+// commits.
+func (r Runner) commitConflicts(applied, conflicts []*modfile.Require, oldVersions map[*modfile.Require]string) error {
+	mod := copyMod(r.OriginalMod)
+	setVersions(mod, applied, r.majorVersionRewrites)
+	setVersions(mod, conflicts, r.majorVersionRewrites)
+	if err := r.writeModFile(mod); err != nil {
+		return err
+	}
+	if err := r.Go.ModTidy(r.RootDir); err != nil {
+		return fmt.Errorf("go mod tidy for grouped conflicts: %w", err)
+	}
+	if err := runGit(r.RootDir, "add", "-A"); err != nil {
+		return fmt.Errorf("git add for grouped conflicts: %w", err)
+	}
+
+	message := []string{"Upgrade modules that only pass together", ""}
+	for _, req := range conflicts {
+		message = append(message, fmt.Sprintf("* %s from %s to %s", req.Mod.Path, oldVersions[req], req.Mod.Version))
+	}
+	if err := runGit(r.RootDir, "commit", "-m", strings.Join(message, "\n")); err != nil {
+		return fmt.Errorf("git commit for grouped conflicts: %w", err)
+	}
+	return nil
+}
+
+// createPR opens a pull/merge request for branch using gh or glab,
+// whichever matches the main module's forge (defaulting to gh).
+func (r Runner) createPR(branch string) error {
+	tool, args := "gh", []string{"pr", "create", "--fill", "--head", branch}
+	if r.OriginalMod != nil && r.OriginalMod.Module != nil {
+		if host, _, ok := repoHost(r.OriginalMod.Module.Mod.Path); ok && host == "gitlab.com" {
+			tool, args = "glab", []string{"mr", "create", "--fill", "--source-branch", branch}
+		}
+	}
+
+	cmd := exec.Command(tool, args...)
+	cmd.Dir = r.RootDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
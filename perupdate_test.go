@@ -0,0 +1,122 @@
+package goupdate
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestChangelogURL(t *testing.T) {
+	tests := []struct {
+		modulePath string
+		want       string
+	}{
+		{"github.com/crewjam/goupdate", "https://github.com/crewjam/goupdate/compare/v1.0.0...v1.1.0"},
+		{"gitlab.com/example/pkg", "https://gitlab.com/example/pkg/-/compare/v1.0.0...v1.1.0"},
+		{"bitbucket.org/example/pkg", "https://bitbucket.org/example/pkg/branches/compare/v1.1.0%0Dv1.0.0"},
+		{"github.com/crewjam/goupdate/v2", "https://github.com/crewjam/goupdate/compare/v1.0.0...v1.1.0"},
+		{"example.com/unknownforge/pkg", ""},
+	}
+	for _, tt := range tests {
+		got := changelogURL(tt.modulePath, "v1.0.0", "v1.1.0")
+		if got != tt.want {
+			t.Errorf("changelogURL(%q): got %q, want %q", tt.modulePath, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultBranchName(t *testing.T) {
+	got := defaultBranchName()
+	if !regexp.MustCompile(`^goupdate/\d{8}$`).MatchString(got) {
+		t.Errorf("defaultBranchName() = %q, want goupdate/YYYYMMDD", got)
+	}
+}
+
+// initGitRepo creates a git repository in dir with an initial commit, so
+// commitPerModule's checkout/commit calls have something to work against.
+func initGitRepo(t *testing.T, dir string) {
+	t.Helper()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+		{"add", "-A"},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+}
+
+// TestCommitPerModuleIsCumulative guards against the per-module commit
+// sequence resetting go.mod to the original plus only the module just
+// committed: the branch HEAD must carry the union of every upgrade that
+// survives, not just the last one.
+func TestCommitPerModuleIsCumulative(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goupdate-commitpermodule")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	originalMod := writeTestModFile(t, dir, map[string]string{
+		"a.example.com/a": "v1.0.0",
+		"b.example.com/b": "v1.0.0",
+		"c.example.com/c": "v1.0.0",
+	})
+	initGitRepo(t, dir)
+
+	updates := []*modfile.Require{
+		{Mod: module.Version{Path: "a.example.com/a", Version: "v1.1.0"}},
+		{Mod: module.Version{Path: "b.example.com/b", Version: "v1.1.0"}},
+		{Mod: module.Version{Path: "c.example.com/c", Version: "v1.1.0"}},
+	}
+	// a and b pass individually; c only passes as part of the batch try()
+	// already settled on, so it should land in the grouped conflicts commit.
+	g := &mockGo{failOn: map[string]string{"c.example.com/c": "v1.1.0"}}
+	r := Runner{RootDir: dir, OriginalMod: originalMod, Go: g, Branch: "goupdate/test"}
+
+	oldVersions := map[*modfile.Require]string{}
+	for _, req := range updates {
+		oldVersions[req] = "v1.0.0"
+	}
+
+	if err := r.commitPerModule(updates, updates, oldVersions); err != nil {
+		t.Fatalf("commitPerModule: %s", err)
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatalf("ReadFile go.mod: %s", err)
+	}
+	mf, err := modfile.Parse("go.mod", buf, nil)
+	if err != nil {
+		t.Fatalf("Parse go.mod: %s", err)
+	}
+
+	for _, req := range updates {
+		if got := requiredVersion(mf, req.Mod.Path); got != req.Mod.Version {
+			t.Errorf("final go.mod requires %s at %q, want %q (a prior commit must not have reverted it)", req.Mod.Path, got, req.Mod.Version)
+		}
+	}
+
+	log, err := exec.Command("git", "-C", dir, "log", "--oneline", "goupdate/test").CombinedOutput()
+	if err != nil {
+		t.Fatalf("git log: %s: %s", err, log)
+	}
+	// initial commit, plus one per independent module (a, b), plus one for
+	// the grouped conflict (c) == 4 commits
+	if got := len(strings.Split(strings.TrimSpace(string(log)), "\n")); got != 4 {
+		t.Errorf("got %d commits on branch, want 4:\n%s", got, log)
+	}
+}
@@ -0,0 +1,156 @@
+package goupdate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// Bump classifies the size of the version change between a module's
+// current version and a candidate update.
+type Bump int
+
+const (
+	// BumpPatch is a patch-level change (vX.Y.Z -> vX.Y.Z+1).
+	BumpPatch Bump = iota
+	// BumpMinor is a minor version change (vX.Y.Z -> vX.Y+1.0).
+	BumpMinor
+	// BumpMajor is a major version change (vX.Y.Z -> vX+1.0.0).
+	BumpMajor
+	// BumpPrerelease is an update to a prerelease version, e.g. vX.Y.Z-rc.1.
+	BumpPrerelease
+	// BumpPseudo is an update to a pseudo-version, e.g.
+	// vX.Y.Z-0.20210101000000-abcdef123456.
+	BumpPseudo
+)
+
+// String implements fmt.Stringer.
+func (b Bump) String() string {
+	switch b {
+	case BumpPatch:
+		return "patch"
+	case BumpMinor:
+		return "minor"
+	case BumpMajor:
+		return "major"
+	case BumpPrerelease:
+		return "prerelease"
+	case BumpPseudo:
+		return "pseudo"
+	}
+	return "unknown"
+}
+
+// ParseBump parses the value of the -max flag.
+func ParseBump(s string) (Bump, error) {
+	switch s {
+	case "patch":
+		return BumpPatch, nil
+	case "minor":
+		return BumpMinor, nil
+	case "major":
+		return BumpMajor, nil
+	}
+	return 0, fmt.Errorf("invalid bump %q, must be one of patch, minor, major", s)
+}
+
+// classifyBump reports how big a jump newVersion is from oldVersion.
+func classifyBump(oldVersion, newVersion string) Bump {
+	if module.IsPseudoVersion(newVersion) {
+		return BumpPseudo
+	}
+	if semver.Prerelease(newVersion) != "" {
+		return BumpPrerelease
+	}
+	if semver.Major(oldVersion) != semver.Major(newVersion) {
+		return BumpMajor
+	}
+	if semver.MajorMinor(oldVersion) != semver.MajorMinor(newVersion) {
+		return BumpMinor
+	}
+	return BumpPatch
+}
+
+// policyAllows reports whether bump is within the bounds configured on
+// r: at most r.MaxBump for ordinary releases, and gated individually by
+// AllowPrerelease/AllowPseudo.
+func (r Runner) policyAllows(bump Bump) bool {
+	switch bump {
+	case BumpPrerelease:
+		return r.AllowPrerelease
+	case BumpPseudo:
+		return r.AllowPseudo
+	default:
+		return bump <= r.MaxBump
+	}
+}
+
+// majorVersionPath reports the module path that req's bump to its candidate
+// version implies, carrying the /v2, /v3, ... suffix appropriate to that
+// version. ok is false if the bump doesn't change the path: either the
+// module path already carries no version suffix (v0 or v1), or the
+// candidate is a +incompatible version, which by definition keeps the
+// module's existing path (go list -m -u reports these, e.g. v1.5.0 ->
+// v2.0.0+incompatible, under the unchanged path; appending /v2 to it would
+// name a module that doesn't exist). It has no side effects: it neither
+// mutates a go.mod nor touches the source tree, so a bump that later fails
+// bisection can simply be discarded without leaving anything to revert.
+// Run sets the candidate's path to the returned one before downloading and
+// testing it, and rewrites imports only once the upgrade has survived try.
+func majorVersionPath(req *modfile.Require) (newPath string, ok bool, err error) {
+	if semver.Build(req.Mod.Version) == "+incompatible" {
+		return "", false, nil
+	}
+
+	basePath, _, splitOK := module.SplitPathVersion(req.Mod.Path)
+	if !splitOK {
+		return "", false, fmt.Errorf("cannot parse module path %q", req.Mod.Path)
+	}
+
+	newMajor := semver.Major(req.Mod.Version)
+	newPath = basePath
+	if newMajor != "v0" && newMajor != "v1" {
+		newPath = basePath + "/" + newMajor
+	}
+	if newPath == req.Mod.Path {
+		return "", false, nil
+	}
+	return newPath, true, nil
+}
+
+// rewriteImports replaces oldPath with newPath at the start of every
+// double-quoted string in every *.go file under rootDir; matches are not
+// limited to import declarations. A match only counts if
+// oldPath is followed by `"` or `/`, so rewriting e.g.
+// github.com/foo/bar to github.com/foo/bar/v2 doesn't also touch an
+// unrelated import of github.com/foo/bartender.
+func rewriteImports(rootDir, oldPath, newPath string) error {
+	pattern := regexp.MustCompile(`"` + regexp.QuoteMeta(oldPath) + `("|/)`)
+	replacement := []byte(`"` + newPath + "$1")
+
+	return filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !pattern.Match(buf) {
+			return nil
+		}
+
+		return ioutil.WriteFile(path, pattern.ReplaceAll(buf, replacement), info.Mode())
+	})
+}
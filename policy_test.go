@@ -0,0 +1,124 @@
+package goupdate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestClassifyBump(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     Bump
+	}{
+		{"v1.2.3", "v1.2.4", BumpPatch},
+		{"v1.2.3", "v1.3.0", BumpMinor},
+		{"v1.2.3", "v2.0.0", BumpMajor},
+		{"v1.2.3", "v1.3.0-rc.1", BumpPrerelease},
+		{"v1.2.3", "v1.2.4-0.20210101000000-abcdef123456", BumpPseudo},
+	}
+	for _, tt := range tests {
+		if got := classifyBump(tt.old, tt.new); got != tt.want {
+			t.Errorf("classifyBump(%q, %q) = %s, want %s", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestRunnerPolicyAllows(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Runner
+		bump Bump
+		want bool
+	}{
+		{"patch within minor policy", Runner{MaxBump: BumpMinor}, BumpPatch, true},
+		{"major exceeds minor policy", Runner{MaxBump: BumpMinor}, BumpMajor, false},
+		{"major within major policy", Runner{MaxBump: BumpMajor}, BumpMajor, true},
+		{"prerelease needs explicit opt-in", Runner{MaxBump: BumpMajor}, BumpPrerelease, false},
+		{"prerelease allowed when opted in", Runner{MaxBump: BumpMajor, AllowPrerelease: true}, BumpPrerelease, true},
+		{"pseudo needs explicit opt-in", Runner{MaxBump: BumpMajor}, BumpPseudo, false},
+		{"pseudo allowed when opted in", Runner{MaxBump: BumpMajor, AllowPseudo: true}, BumpPseudo, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.policyAllows(tt.bump); got != tt.want {
+				t.Errorf("policyAllows(%s) = %v, want %v", tt.bump, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMajorVersionPath(t *testing.T) {
+	tests := []struct {
+		name          string
+		path, version string
+		wantPath      string
+		wantOK        bool
+	}{
+		{"major bump gains a version suffix", "example.com/foo", "v2.0.0", "example.com/foo/v2", true},
+		{"already-versioned path bumps its suffix", "example.com/foo/v2", "v3.0.0", "example.com/foo/v3", true},
+		{"v0 stays unsuffixed", "example.com/foo", "v0.2.0", "", false},
+		{"v1 stays unsuffixed", "example.com/foo", "v1.2.0", "", false},
+		{"+incompatible bump keeps the module's unsuffixed path", "example.com/foo", "v2.0.0+incompatible", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &modfile.Require{Mod: module.Version{Path: tt.path, Version: tt.version}}
+			gotPath, gotOK, err := majorVersionPath(req)
+			if err != nil {
+				t.Fatalf("majorVersionPath: %s", err)
+			}
+			if gotOK != tt.wantOK || gotPath != tt.wantPath {
+				t.Errorf("majorVersionPath(%s@%s) = (%q, %v), want (%q, %v)", tt.path, tt.version, gotPath, gotOK, tt.wantPath, tt.wantOK)
+			}
+			// majorVersionPath must not mutate req: a rejected candidate has
+			// nothing to revert.
+			if req.Mod.Path != tt.path {
+				t.Errorf("majorVersionPath mutated req.Mod.Path to %q", req.Mod.Path)
+			}
+		})
+	}
+}
+
+func TestRewriteImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goupdate-rewrite")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"pkg.go":   "package pkg\n\nimport \"example.com/foo\"\n\nvar _ = foo.Thing\n",
+		"unrel.go": "package pkg\n\nimport \"example.com/footender\"\n\nvar _ = footender.Thing\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+
+	if err := rewriteImports(dir, "example.com/foo", "example.com/foo/v2"); err != nil {
+		t.Fatalf("rewriteImports: %s", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "pkg.go"))
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if want := `"example.com/foo/v2"`; !strings.Contains(string(got), want) {
+		t.Errorf("source import not rewritten, got:\n%s", got)
+	}
+
+	gotUnrel, err := ioutil.ReadFile(filepath.Join(dir, "unrel.go"))
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if !strings.Contains(string(gotUnrel), `"example.com/footender"`) {
+		t.Errorf("unrelated import with oldPath as a substring was wrongly rewritten, got:\n%s", gotUnrel)
+	}
+}
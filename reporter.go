@@ -0,0 +1,282 @@
+package goupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"golang.org/x/mod/modfile"
+)
+
+// Reporter receives progress events as Run executes, so that the core
+// update/bisection logic stays agnostic of how (or whether) that progress
+// is displayed. TextReporter prints colored, human-readable progress as it
+// happens; JSONReporter instead accumulates a Report and emits
+// it as a single JSON document from Finish.
+type Reporter interface {
+	// InitialTest reports the result of the pre-upgrade test run.
+	InitialTest(passed bool)
+
+	// Skipped reports a candidate that was excluded before testing, by
+	// policy or because the cache already knows it fails.
+	Skipped(s SkippedUpdate)
+
+	// UpToDate reports that there were no candidate updates at all.
+	UpToDate()
+
+	// Attempting reports that a subset of updates is about to be tested.
+	// originalVersion returns the currently-required version of a module
+	// path, for display.
+	Attempting(indent string, updates []*modfile.Require, originalVersion func(string) string)
+
+	// AttemptResult reports the outcome of the subset most recently passed
+	// to Attempting.
+	AttemptResult(indent string, updates []*modfile.Require, pass, cacheHit bool, duration time.Duration)
+
+	// Bisected reports the updates that survived splitting a failing
+	// subset of size total into two smaller subsets.
+	Bisected(indent string, kept []*modfile.Require, total int, originalVersion func(string) string)
+
+	// FinalTest reports the result of the post-upgrade test run.
+	FinalTest(passed bool)
+
+	// Candidate reports the final disposition of one candidate update.
+	Candidate(path, oldVersion, newVersion, status string)
+
+	// Finish is called once, when Run returns, with a unified-ish diff of
+	// go.mod; it is not called if Run fails before it has read go.mod. It
+	// returns any error encountered while emitting the report.
+	Finish(modDiff string) error
+}
+
+// passFailString renders a cached test result for the progress log.
+func passFailString(ok bool) string {
+	if ok {
+		return "pass"
+	}
+	return "fail"
+}
+
+// TextReporter is the default Reporter: it prints colored, human-readable
+// progress to stdout as Run executes.
+type TextReporter struct{}
+
+// NewTextReporter returns a Reporter that prints human-readable progress.
+func NewTextReporter() *TextReporter {
+	return &TextReporter{}
+}
+
+func (*TextReporter) InitialTest(passed bool) {
+	if !passed {
+		fmt.Printf("%s\n", color.RedString("test failed before upgrading anything, aborting."))
+	}
+}
+
+func (*TextReporter) Skipped(s SkippedUpdate) {
+	fmt.Printf("%s: %s %s -> %s (%s)\n", color.YellowString("skipped"), s.Path, s.OldVersion, s.NewVersion, s.Reason)
+}
+
+func (*TextReporter) UpToDate() {
+	fmt.Printf("%s\n", color.GreenString("all packages are up to date"))
+}
+
+func (*TextReporter) Attempting(indent string, updates []*modfile.Require, originalVersion func(string) string) {
+	fmt.Printf("%strying %d updates\n", indent, len(updates))
+	for _, req := range updates {
+		fmt.Printf("%s  %s: %s -> %s\n", indent, req.Mod.Path, originalVersion(req.Mod.Path), req.Mod.Version)
+	}
+}
+
+func (*TextReporter) AttemptResult(indent string, updates []*modfile.Require, pass, cacheHit bool, duration time.Duration) {
+	switch {
+	case cacheHit:
+		fmt.Printf("%s  cache hit: %s\n", indent, passFailString(pass))
+	case pass:
+		fmt.Printf("%s  test passed\n", indent)
+	default:
+		fmt.Printf("%s  test failed\n", indent)
+	}
+}
+
+func (*TextReporter) Bisected(indent string, kept []*modfile.Require, total int, originalVersion func(string) string) {
+	fmt.Printf("%skeeping %d of %d updates:\n", indent, len(kept), total)
+	for _, req := range kept {
+		fmt.Printf("%s  %s: %s -> %s\n", indent, req.Mod.Path, originalVersion(req.Mod.Path), req.Mod.Version)
+	}
+}
+
+func (*TextReporter) FinalTest(passed bool) {
+	if !passed {
+		fmt.Printf("%s\n", color.RedString("test failed after applying upgrades, aborting."))
+	}
+}
+
+func (*TextReporter) Candidate(path, oldVersion, newVersion, status string) {
+	switch status {
+	case "upgraded":
+		fmt.Printf("%s: %s %s -> %s\n", color.GreenString("package upgraded"), path, oldVersion, newVersion)
+	case "failed":
+		fmt.Printf("%s: %s %s -> %s\n", color.RedString("package upgrade failed"), path, oldVersion, newVersion)
+	}
+}
+
+func (*TextReporter) Finish(modDiff string) error {
+	return nil
+}
+
+// AttemptReport records one subset of updates that was tested (or would
+// have been, had the cache not already known the answer).
+type AttemptReport struct {
+	Updates  []string `json:"updates"` // "path@version"
+	Pass     bool     `json:"pass"`
+	CacheHit bool     `json:"cacheHit"`
+	Duration string   `json:"duration"`
+}
+
+// CandidateReport records the final disposition of a single candidate
+// update.
+type CandidateReport struct {
+	Path       string `json:"path"`
+	OldVersion string `json:"oldVersion"`
+	NewVersion string `json:"newVersion"`
+	Status     string `json:"status"` // upgraded, failed, skipped-policy, skipped-cache
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Report is the JSON document JSONReporter emits from Finish. Modeled
+// loosely on `go list -m -json`: one flat, directly-marshalable struct
+// rather than a wrapper type per event.
+type Report struct {
+	InitialTestPassed bool              `json:"initialTestPassed"`
+	UpToDate          bool              `json:"upToDate,omitempty"`
+	Attempts          []AttemptReport   `json:"attempts,omitempty"`
+	Candidates        []CandidateReport `json:"candidates,omitempty"`
+	FinalTestPassed   bool              `json:"finalTestPassed"`
+	ModDiff           string            `json:"modDiff,omitempty"`
+}
+
+// JSONReporter accumulates progress events into a Report and writes it as
+// a single JSON document from Finish. Safe for concurrent use, since Run
+// bisects failing subsets across goroutines.
+type JSONReporter struct {
+	// Writer is where Finish writes the report. Defaults to os.Stdout.
+	Writer io.Writer
+
+	mu     sync.Mutex
+	report Report
+}
+
+// NewJSONReporter returns a Reporter that emits a single JSON document to
+// stdout from Finish.
+func NewJSONReporter() *JSONReporter {
+	return &JSONReporter{}
+}
+
+func (j *JSONReporter) InitialTest(passed bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.report.InitialTestPassed = passed
+}
+
+func (j *JSONReporter) Skipped(s SkippedUpdate) {
+	status := "skipped-policy"
+	if s.Cached {
+		status = "skipped-cache"
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.report.Candidates = append(j.report.Candidates, CandidateReport{
+		Path: s.Path, OldVersion: s.OldVersion, NewVersion: s.NewVersion, Status: status, Reason: s.Reason,
+	})
+}
+
+func (j *JSONReporter) UpToDate() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.report.UpToDate = true
+}
+
+func (*JSONReporter) Attempting(indent string, updates []*modfile.Require, originalVersion func(string) string) {
+}
+
+func (j *JSONReporter) AttemptResult(indent string, updates []*modfile.Require, pass, cacheHit bool, duration time.Duration) {
+	tuples := make([]string, len(updates))
+	for i, req := range updates {
+		tuples[i] = req.Mod.Path + "@" + req.Mod.Version
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.report.Attempts = append(j.report.Attempts, AttemptReport{
+		Updates: tuples, Pass: pass, CacheHit: cacheHit, Duration: duration.String(),
+	})
+}
+
+func (*JSONReporter) Bisected(indent string, kept []*modfile.Require, total int, originalVersion func(string) string) {
+}
+
+func (j *JSONReporter) FinalTest(passed bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.report.FinalTestPassed = passed
+}
+
+func (j *JSONReporter) Candidate(path, oldVersion, newVersion, status string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.report.Candidates = append(j.report.Candidates, CandidateReport{
+		Path: path, OldVersion: oldVersion, NewVersion: newVersion, Status: status,
+	})
+}
+
+func (j *JSONReporter) Finish(modDiff string) error {
+	j.mu.Lock()
+	j.report.ModDiff = modDiff
+	buf, err := json.MarshalIndent(&j.report, "", "  ")
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	w := j.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	_, err = fmt.Fprintln(w, string(buf))
+	return err
+}
+
+// modDiff returns a minimal line-based diff between oldBuf and newBuf:
+// lines only in oldBuf are prefixed with '-', lines only in newBuf with
+// '+'. It's deliberately not a full LCS diff -- go.mod files are short and
+// mostly just have their require versions changed.
+func modDiff(oldBuf, newBuf []byte) string {
+	oldLines := strings.Split(string(oldBuf), "\n")
+	newLines := strings.Split(string(newBuf), "\n")
+
+	oldSet := map[string]bool{}
+	for _, l := range oldLines {
+		oldSet[l] = true
+	}
+	newSet := map[string]bool{}
+	for _, l := range newLines {
+		newSet[l] = true
+	}
+
+	var b strings.Builder
+	for _, l := range oldLines {
+		if !newSet[l] {
+			fmt.Fprintf(&b, "-%s\n", l)
+		}
+	}
+	for _, l := range newLines {
+		if !oldSet[l] {
+			fmt.Fprintf(&b, "+%s\n", l)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package goupdate
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+func TestJSONReporterFinish(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := &JSONReporter{Writer: &buf}
+
+	reporter.InitialTest(true)
+	reporter.Skipped(SkippedUpdate{Path: "a.example.com/a", OldVersion: "v1.0.0", NewVersion: "v2.0.0", Bump: BumpMajor, Reason: "major bump not allowed"})
+	reporter.Skipped(SkippedUpdate{Path: "b.example.com/b", OldVersion: "v1.0.0", NewVersion: "v1.4.0", Reason: "known to fail on its own (cached)", Cached: true})
+	updates := []*modfile.Require{{Mod: module.Version{Path: "c.example.com/c", Version: "v1.1.0"}}}
+	reporter.AttemptResult("", updates, true, false, 0)
+	reporter.FinalTest(true)
+	reporter.Candidate("c.example.com/c", "v1.0.0", "v1.1.0", "upgraded")
+
+	if err := reporter.Finish("-old\n+new\n"); err != nil {
+		t.Fatalf("Finish: %s", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Unmarshal: %s\noutput: %s", err, buf.String())
+	}
+
+	if !report.InitialTestPassed || !report.FinalTestPassed {
+		t.Fatalf("report did not record initial/final test results: %+v", report)
+	}
+	if len(report.Attempts) != 1 || report.Attempts[0].Updates[0] != "c.example.com/c@v1.1.0" {
+		t.Fatalf("unexpected attempts: %+v", report.Attempts)
+	}
+	if len(report.Candidates) != 3 {
+		t.Fatalf("got %d candidates, want 3: %+v", len(report.Candidates), report.Candidates)
+	}
+
+	var gotStatuses []string
+	for _, c := range report.Candidates {
+		gotStatuses = append(gotStatuses, c.Status)
+	}
+	want := []string{"skipped-policy", "skipped-cache", "upgraded"}
+	for i, w := range want {
+		if gotStatuses[i] != w {
+			t.Errorf("candidate %d: got status %q, want %q", i, gotStatuses[i], w)
+		}
+	}
+	if report.ModDiff != "-old\n+new\n" {
+		t.Errorf("got ModDiff %q, want %q", report.ModDiff, "-old\n+new\n")
+	}
+}
+
+func TestModDiff(t *testing.T) {
+	got := modDiff([]byte("a\nb\nc\n"), []byte("a\nx\nc\n"))
+	want := "-b\n+x\n"
+	if got != want {
+		t.Errorf("modDiff: got %q, want %q", got, want)
+	}
+}
+
+func TestRunnerRunEmitsJSONReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goupdate-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestModFile(t, dir, map[string]string{"a.example.com/a": "v1.0.0"})
+
+	g := &mockGo{listUpdatesOutput: []byte(`{"Path":"a.example.com/a","Version":"v1.0.0","Update":{"Path":"a.example.com/a","Version":"v1.1.0"}}`)}
+
+	var buf bytes.Buffer
+	reporter := &JSONReporter{Writer: &buf}
+	r := &Runner{RootDir: dir, TestCommand: "true", Go: g, Reporter: reporter, MaxBump: BumpMajor, NoCache: true}
+	if err := r.Run(); err != nil {
+		t.Fatalf("Run: %s", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Unmarshal: %s\noutput: %s", err, buf.String())
+	}
+	if !report.InitialTestPassed {
+		t.Fatalf("report should show the initial test passed: %+v", report)
+	}
+	if len(report.Candidates) != 1 || report.Candidates[0].Status != "upgraded" {
+		t.Fatalf("expected a.example.com/a to be reported upgraded, got: %+v", report.Candidates)
+	}
+}